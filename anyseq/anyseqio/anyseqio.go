@@ -0,0 +1,280 @@
+// Package anyseqio persists anyseq.Seq values to disk or
+// over the wire in a small, chunk-oriented binary format,
+// so that preprocessed training data (or cached RNN
+// inputs) can be written once and read back without every
+// caller reinventing a serialization format.
+//
+// The format is a short header (magic, element type, and
+// row size) followed by one length-prefixed chunk per
+// *anyseq.Batch: a bit-packed Present bitmap, the Packed
+// values in little-endian order, and a CRC32 of the rest
+// of the chunk.
+package anyseqio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/unixpickle/anydiff"
+	"github.com/unixpickle/anydiff/anyseq"
+	"github.com/unixpickle/anyvec"
+)
+
+const (
+	magic = "ASQ1"
+
+	elemFloat32 = 1
+	elemFloat64 = 2
+)
+
+// Encoder writes a Seq's batches to an io.Writer.
+type Encoder struct {
+	w        *bufio.Writer
+	rowSize  int
+	elemType byte
+	wroteHdr bool
+}
+
+// NewEncoder creates an Encoder that writes to w.
+//
+// rowSize is the number of vector components per present
+// row (i.e. Packed.Len()/NumPresent() for every batch that
+// will be passed to Encode), and must be the same for
+// every batch written by this Encoder.
+func NewEncoder(w io.Writer, c anyvec.Creator, rowSize int) (*Encoder, error) {
+	et, err := elemTypeOf(c)
+	if err != nil {
+		return nil, fmt.Errorf("new anyseqio encoder: %s", err)
+	}
+	return &Encoder{w: bufio.NewWriter(w), rowSize: rowSize, elemType: et}, nil
+}
+
+// Encode writes every batch of s, in order.
+func (e *Encoder) Encode(s anyseq.Seq) error {
+	for _, b := range s.Output() {
+		if err := e.EncodeBatch(b); err != nil {
+			return fmt.Errorf("encode seq: %s", err)
+		}
+	}
+	return nil
+}
+
+// EncodeBatch writes a single batch, writing the header
+// first if this is the first batch written.
+func (e *Encoder) EncodeBatch(b *anyseq.Batch) error {
+	if !e.wroteHdr {
+		if err := e.writeHeader(); err != nil {
+			return fmt.Errorf("encode batch: %s", err)
+		}
+		e.wroteHdr = true
+	}
+
+	bitmap := packPresent(b.Present)
+	values, err := vectorBytes(b.Packed, e.elemType)
+	if err != nil {
+		return fmt.Errorf("encode batch: %s", err)
+	}
+
+	crc := crc32.NewIEEE()
+	mw := io.MultiWriter(e.w, crc)
+	if err := binary.Write(mw, binary.LittleEndian, uint32(len(b.Present))); err != nil {
+		return fmt.Errorf("encode batch: %s", err)
+	}
+	if _, err := mw.Write(bitmap); err != nil {
+		return fmt.Errorf("encode batch: %s", err)
+	}
+	if _, err := mw.Write(values); err != nil {
+		return fmt.Errorf("encode batch: %s", err)
+	}
+	if err := binary.Write(e.w, binary.LittleEndian, crc.Sum32()); err != nil {
+		return fmt.Errorf("encode batch: %s", err)
+	}
+	return nil
+}
+
+// Close flushes any buffered output. It does not close the
+// underlying io.Writer.
+func (e *Encoder) Close() error {
+	if !e.wroteHdr {
+		if err := e.writeHeader(); err != nil {
+			return fmt.Errorf("close anyseqio encoder: %s", err)
+		}
+		e.wroteHdr = true
+	}
+	return e.w.Flush()
+}
+
+func (e *Encoder) writeHeader() error {
+	if _, err := e.w.WriteString(magic); err != nil {
+		return err
+	}
+	if err := e.w.WriteByte(e.elemType); err != nil {
+		return err
+	}
+	return binary.Write(e.w, binary.LittleEndian, uint32(e.rowSize))
+}
+
+// Decoder reads batches written by an Encoder.
+type Decoder struct {
+	r        *bufio.Reader
+	creator  anyvec.Creator
+	rowSize  int
+	elemType byte
+}
+
+// NewDecoder reads the header from r and prepares to
+// decode batches, constructing Packed vectors with c.
+func NewDecoder(r io.Reader, c anyvec.Creator) (*Decoder, error) {
+	br := bufio.NewReader(r)
+
+	hdr := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return nil, fmt.Errorf("new anyseqio decoder: read header: %s", err)
+	}
+	if string(hdr[:len(magic)]) != magic {
+		return nil, errors.New("new anyseqio decoder: bad magic number")
+	}
+	elemType := hdr[len(magic)]
+	if elemType != elemFloat32 && elemType != elemFloat64 {
+		return nil, errors.New("new anyseqio decoder: unknown element type")
+	}
+
+	var rowSize uint32
+	if err := binary.Read(br, binary.LittleEndian, &rowSize); err != nil {
+		return nil, fmt.Errorf("new anyseqio decoder: read header: %s", err)
+	}
+
+	return &Decoder{r: br, creator: c, rowSize: int(rowSize), elemType: elemType}, nil
+}
+
+// RowSize returns the row size recorded in the header.
+func (d *Decoder) RowSize() int {
+	return d.rowSize
+}
+
+// Next reads and returns the next batch. It returns
+// ok == false, with a nil error, once the stream is
+// exhausted.
+func (d *Decoder) Next() (batch *anyseq.Batch, ok bool, err error) {
+	var numSlots uint32
+	if err := binary.Read(d.r, binary.LittleEndian, &numSlots); err != nil {
+		if err == io.EOF {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("decode batch: %s", err)
+	}
+
+	crc := crc32.NewIEEE()
+	tr := io.TeeReader(d.r, crc)
+	if err := binary.Write(crc, binary.LittleEndian, numSlots); err != nil {
+		return nil, false, fmt.Errorf("decode batch: %s", err)
+	}
+
+	bitmap := make([]byte, bitmapLen(int(numSlots)))
+	if _, err := io.ReadFull(tr, bitmap); err != nil {
+		return nil, false, fmt.Errorf("decode batch: %s", err)
+	}
+	present := unpackPresent(bitmap, int(numSlots))
+
+	n := 0
+	for _, p := range present {
+		if p {
+			n++
+		}
+	}
+	values := make([]byte, n*d.rowSize*elemSize(d.elemType))
+	if _, err := io.ReadFull(tr, values); err != nil {
+		return nil, false, fmt.Errorf("decode batch: %s", err)
+	}
+
+	var wantCRC uint32
+	if err := binary.Read(d.r, binary.LittleEndian, &wantCRC); err != nil {
+		return nil, false, fmt.Errorf("decode batch: %s", err)
+	}
+	if wantCRC != crc.Sum32() {
+		return nil, false, errors.New("decode batch: CRC mismatch")
+	}
+
+	vec, err := bytesToVector(d.creator, d.elemType, values)
+	if err != nil {
+		return nil, false, fmt.Errorf("decode batch: %s", err)
+	}
+
+	return &anyseq.Batch{Packed: vec, Present: present}, true, nil
+}
+
+// Decode reads every batch from r and returns
+// them as a Seq with no trainable variables, suitable for
+// use as a leaf input to a model.
+func Decode(r io.Reader, c anyvec.Creator) (anyseq.Seq, error) {
+	dec, err := NewDecoder(r, c)
+	if err != nil {
+		return nil, err
+	}
+	var out []*anyseq.Batch
+	for {
+		b, ok, err := dec.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		out = append(out, b)
+	}
+	return &constSeq{creator: c, out: out}, nil
+}
+
+// NewLazySeq returns a Seq that only reads its batches
+// from r the first time its Output method is called, so
+// that a large cached dataset can be opened cheaply and
+// only materialized (e.g. onto the GPU) when it is
+// actually used.
+func NewLazySeq(r io.Reader, c anyvec.Creator) (anyseq.Seq, error) {
+	dec, err := NewDecoder(r, c)
+	if err != nil {
+		return nil, err
+	}
+	return &constSeq{creator: c, dec: dec}, nil
+}
+
+// constSeq is a leaf Seq: it holds no trainable variables,
+// so Propagate is a no-op. Its batches come either from an
+// already-decoded slice (Decode) or are pulled lazily from
+// a Decoder the first time Output is called (NewLazySeq).
+type constSeq struct {
+	creator anyvec.Creator
+	dec     *Decoder
+	out     []*anyseq.Batch
+}
+
+func (c *constSeq) Creator() anyvec.Creator {
+	return c.creator
+}
+
+func (c *constSeq) Output() []*anyseq.Batch {
+	if c.out == nil && c.dec != nil {
+		for {
+			b, ok, err := c.dec.Next()
+			if err != nil {
+				panic(err)
+			}
+			if !ok {
+				break
+			}
+			c.out = append(c.out, b)
+		}
+	}
+	return c.out
+}
+
+func (c *constSeq) Vars() anydiff.VarSet {
+	return anydiff.VarSet{}
+}
+
+func (c *constSeq) Propagate(upstream []*anyseq.Batch, g anydiff.Grad) {
+}
@@ -0,0 +1,112 @@
+package anyseqio
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/unixpickle/anydiff/anyseq"
+	"github.com/unixpickle/anyvec/anyvec32"
+)
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	c := anyvec32.CurrentCreator()
+	const rowSize = 2
+
+	batches := []*anyseq.Batch{
+		{
+			Packed:  c.MakeVectorData([]float32{1, 2, 3, 4}),
+			Present: []bool{true, true, false},
+		},
+		{
+			Packed:  c.MakeVectorData([]float32{5, 6}),
+			Present: []bool{false, true, false},
+		},
+	}
+
+	var buf bytes.Buffer
+	enc, err := NewEncoder(&buf, c, rowSize)
+	if err != nil {
+		t.Fatalf("new encoder: %s", err)
+	}
+	for _, b := range batches {
+		if err := enc.EncodeBatch(b); err != nil {
+			t.Fatalf("encode batch: %s", err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("close encoder: %s", err)
+	}
+
+	dec, err := NewDecoder(bytes.NewReader(buf.Bytes()), c)
+	if err != nil {
+		t.Fatalf("new decoder: %s", err)
+	}
+	if dec.RowSize() != rowSize {
+		t.Fatalf("expected row size %d, got %d", rowSize, dec.RowSize())
+	}
+
+	for i, want := range batches {
+		got, ok, err := dec.Next()
+		if err != nil {
+			t.Fatalf("decode batch %d: %s", i, err)
+		}
+		if !ok {
+			t.Fatalf("expected a batch at index %d", i)
+		}
+		if len(got.Present) != len(want.Present) {
+			t.Fatalf("batch %d: present length mismatch", i)
+		}
+		for j, p := range want.Present {
+			if got.Present[j] != p {
+				t.Fatalf("batch %d: present mismatch at %d", i, j)
+			}
+		}
+
+		gotData := got.Packed.Data().([]float32)
+		wantData := want.Packed.Data().([]float32)
+		if len(gotData) != len(wantData) {
+			t.Fatalf("batch %d: packed length mismatch", i)
+		}
+		for j, x := range wantData {
+			if gotData[j] != x {
+				t.Fatalf("batch %d: packed mismatch at %d: got %v want %v", i, j, gotData[j], x)
+			}
+		}
+	}
+
+	if _, ok, err := dec.Next(); ok || err != nil {
+		t.Fatalf("expected end of stream, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestLazySeq(t *testing.T) {
+	c := anyvec32.CurrentCreator()
+
+	var buf bytes.Buffer
+	enc, err := NewEncoder(&buf, c, 1)
+	if err != nil {
+		t.Fatalf("new encoder: %s", err)
+	}
+	batch := &anyseq.Batch{
+		Packed:  c.MakeVectorData([]float32{1, 2, 3}),
+		Present: []bool{true, true, true},
+	}
+	if err := enc.EncodeBatch(batch); err != nil {
+		t.Fatalf("encode batch: %s", err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("close encoder: %s", err)
+	}
+
+	seq, err := NewLazySeq(bytes.NewReader(buf.Bytes()), c)
+	if err != nil {
+		t.Fatalf("new lazy seq: %s", err)
+	}
+	out := seq.Output()
+	if len(out) != 1 {
+		t.Fatalf("expected 1 batch, got %d", len(out))
+	}
+	if out[0].Packed.Len() != 3 {
+		t.Fatalf("expected 3 packed values, got %d", out[0].Packed.Len())
+	}
+}
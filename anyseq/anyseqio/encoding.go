@@ -0,0 +1,93 @@
+package anyseqio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/unixpickle/anyvec"
+)
+
+func elemTypeOf(c anyvec.Creator) (byte, error) {
+	switch c.MakeVector(1).Data().(type) {
+	case []float32:
+		return elemFloat32, nil
+	case []float64:
+		return elemFloat64, nil
+	default:
+		return 0, fmt.Errorf("unsupported numeric type for creator %T", c)
+	}
+}
+
+func elemSize(elemType byte) int {
+	if elemType == elemFloat64 {
+		return 8
+	}
+	return 4
+}
+
+func bitmapLen(numSlots int) int {
+	return (numSlots + 7) / 8
+}
+
+func packPresent(present []bool) []byte {
+	bitmap := make([]byte, bitmapLen(len(present)))
+	for i, p := range present {
+		if p {
+			bitmap[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return bitmap
+}
+
+func unpackPresent(bitmap []byte, numSlots int) []bool {
+	present := make([]bool, numSlots)
+	for i := range present {
+		present[i] = bitmap[i/8]&(1<<uint(i%8)) != 0
+	}
+	return present
+}
+
+func vectorBytes(v anyvec.Vector, elemType byte) ([]byte, error) {
+	switch data := v.Data().(type) {
+	case []float32:
+		if elemType != elemFloat32 {
+			return nil, fmt.Errorf("vector element type does not match header")
+		}
+		out := make([]byte, 4*len(data))
+		for i, x := range data {
+			binary.LittleEndian.PutUint32(out[i*4:], math.Float32bits(x))
+		}
+		return out, nil
+	case []float64:
+		if elemType != elemFloat64 {
+			return nil, fmt.Errorf("vector element type does not match header")
+		}
+		out := make([]byte, 8*len(data))
+		for i, x := range data {
+			binary.LittleEndian.PutUint64(out[i*8:], math.Float64bits(x))
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported numeric type %T", data)
+	}
+}
+
+func bytesToVector(c anyvec.Creator, elemType byte, data []byte) (anyvec.Vector, error) {
+	switch elemType {
+	case elemFloat32:
+		out := make([]float32, len(data)/4)
+		for i := range out {
+			out[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+		}
+		return c.MakeVectorData(out), nil
+	case elemFloat64:
+		out := make([]float64, len(data)/8)
+		for i := range out {
+			out[i] = math.Float64frombits(binary.LittleEndian.Uint64(data[i*8:]))
+		}
+		return c.MakeVectorData(out), nil
+	default:
+		return nil, fmt.Errorf("unknown element type %d", elemType)
+	}
+}
@@ -0,0 +1,207 @@
+package anyseq
+
+import (
+	"github.com/unixpickle/anydiff"
+	"github.com/unixpickle/anyvec"
+)
+
+// SeamPolicy controls how ConcatTime reconciles sequences
+// whose present-map width (i.e. number of sequence slots)
+// differs from one another.
+type SeamPolicy int
+
+const (
+	// SeamPanic requires every sequence to have the same
+	// present-map width.
+	SeamPanic SeamPolicy = iota
+
+	// SeamPad widens every sequence's present map to the
+	// maximum width among the inputs, treating the added
+	// slots as always absent.
+	SeamPad
+
+	// SeamTruncate narrows every sequence's present map to
+	// the minimum width among the inputs, dropping any
+	// slot beyond that width entirely.
+	SeamTruncate
+)
+
+// ConcatTime glues seqs end-to-end along the time axis: the
+// result's batches are the batches of seqs[0], followed by
+// those of seqs[1], and so on.
+//
+// If the sequences disagree about present-map width,
+// policy says how to reconcile them before gluing.
+func ConcatTime(policy SeamPolicy, seqs ...Seq) Seq {
+	if len(seqs) == 0 {
+		panic("anyseq: ConcatTime: no sequences given")
+	}
+
+	outs := make([][]*Batch, len(seqs))
+	widths := make([]int, len(seqs))
+	width := -1
+	for i, s := range seqs {
+		outs[i] = s.Output()
+		if len(outs[i]) == 0 {
+			continue
+		}
+		widths[i] = len(outs[i][0].Present)
+		if width == -1 {
+			width = widths[i]
+		}
+	}
+	if width == -1 {
+		width = 0
+	}
+
+	switch policy {
+	case SeamPad:
+		for _, w := range widths {
+			if w > width {
+				width = w
+			}
+		}
+	case SeamTruncate:
+		for _, w := range widths {
+			if w > 0 && w < width {
+				width = w
+			}
+		}
+	default:
+		for _, w := range widths {
+			if w != 0 && w != width {
+				panic("anyseq: ConcatTime: mismatched present-map width at seam")
+			}
+		}
+	}
+
+	res := &concatTimeRes{In: seqs, Splits: make([]int, len(seqs))}
+	for i, batches := range outs {
+		res.Splits[i] = len(batches)
+		for _, b := range batches {
+			res.Out = append(res.Out, reconcileWidth(b, width))
+		}
+	}
+	return res
+}
+
+// reconcileWidth returns a batch equivalent to b but with
+// exactly width present-map slots, padding with absent
+// slots or dropping trailing slots as needed.
+//
+// Unlike Batch.Expand/Batch.Reduce, which only ever toggle
+// which slots of a present map of a fixed width are
+// present, this changes the width itself, so it cannot be
+// implemented in terms of either.
+func reconcileWidth(b *Batch, width int) *Batch {
+	w := len(b.Present)
+	if w == width {
+		return b
+	}
+	if w < width {
+		return widenBatch(b, width)
+	}
+	return narrowBatch(b, width)
+}
+
+// widenBatch appends always-absent slots to the end of b's
+// present map until it has exactly width slots. Since the
+// new slots are absent, the packed data is untouched.
+func widenBatch(b *Batch, width int) *Batch {
+	present := make([]bool, width)
+	copy(present, b.Present)
+	return &Batch{Packed: b.Packed, Present: present}
+}
+
+// narrowBatch drops every slot at index width and beyond
+// from b's present map, along with any packed rows those
+// slots contributed.
+func narrowBatch(b *Batch, width int) *Batch {
+	present := make([]bool, width)
+	copy(present, b.Present[:width])
+
+	n := b.NumPresent()
+	var inc int
+	if n > 0 {
+		inc = b.Packed.Len() / n
+	}
+
+	dstOffsets := make([]int, 0, n)
+	var dst int
+	for i, pres := range b.Present {
+		if !pres {
+			continue
+		}
+		if i < width {
+			dstOffsets = append(dstOffsets, dst)
+			dst += inc
+		} else {
+			dstOffsets = append(dstOffsets, -1)
+		}
+	}
+
+	return &Batch{
+		Packed:  scatterRows(b.Packed, inc, dstOffsets, dst),
+		Present: present,
+	}
+}
+
+type concatTimeRes struct {
+	In     []Seq
+	Out    []*Batch
+	Splits []int
+}
+
+func (c *concatTimeRes) Creator() anyvec.Creator {
+	return c.In[0].Creator()
+}
+
+func (c *concatTimeRes) Output() []*Batch {
+	return c.Out
+}
+
+func (c *concatTimeRes) Vars() anydiff.VarSet {
+	varSets := make([]anydiff.VarSet, len(c.In))
+	for i, s := range c.In {
+		varSets[i] = s.Vars()
+	}
+	return anydiff.MergeVarSets(varSets...)
+}
+
+func (c *concatTimeRes) Propagate(u []*Batch, g anydiff.Grad) {
+	idx := 0
+	for i, s := range c.In {
+		n := c.Splits[i]
+		orig := s.Output()
+		sub := make([]*Batch, n)
+		for j := 0; j < n; j++ {
+			var up *Batch
+			if idx+j < len(u) {
+				up = u[idx+j]
+			} else {
+				out := c.Out[idx+j]
+				up = &Batch{
+					Packed:  out.Packed.Creator().MakeVector(out.Packed.Len()),
+					Present: out.Present,
+				}
+			}
+			sub[j] = unreconcileWidth(up, len(orig[j].Present))
+		}
+		idx += n
+		s.Propagate(sub, g)
+	}
+}
+
+// unreconcileWidth undoes reconcileWidth, converting a
+// gradient batch back to the width the source sequence
+// originally used.
+func unreconcileWidth(b *Batch, width int) *Batch {
+	w := len(b.Present)
+	if w == width {
+		return b
+	}
+	if width > w {
+		return widenBatch(b, width)
+	}
+	return narrowBatch(b, width)
+}
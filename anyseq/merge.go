@@ -0,0 +1,172 @@
+package anyseq
+
+import (
+	"github.com/unixpickle/anydiff"
+	"github.com/unixpickle/anyvec"
+)
+
+// Merge combines several Seqs that share a timeline but
+// occupy disjoint sequence slots (i.e. at most one input
+// may have Present[i] true for a given slot at a given
+// timestep) into a single Seq whose batches' Present maps
+// are the union of the inputs'.
+//
+// Every Seq in seqs must produce the same number of
+// timesteps.
+func Merge(seqs ...Seq) Seq {
+	if len(seqs) == 0 {
+		panic("anyseq: Merge: no sequences given")
+	}
+
+	outs := make([][]*Batch, len(seqs))
+	for i, s := range seqs {
+		outs[i] = s.Output()
+		if len(outs[i]) != len(outs[0]) {
+			panic("anyseq: Merge: sequences must have the same length")
+		}
+	}
+	for t := range outs[0] {
+		n := len(outs[0][t].Present)
+		for _, o := range outs {
+			if len(o[t].Present) != n {
+				panic("anyseq: Merge: sequences must have the same number of slots at every timestep")
+			}
+		}
+	}
+
+	res := &mergeRes{
+		In:    seqs,
+		Out:   make([]*Batch, len(outs[0])),
+		Owner: make([][]int, len(outs[0])),
+	}
+	for t := range res.Out {
+		res.Out[t], res.Owner[t] = mergeStep(outs, t)
+	}
+	return res
+}
+
+// mergeStep merges the t-th batch of every sequence in
+// outs, returning the merged batch along with, for every
+// slot, the index into outs that contributed it (or -1 if
+// no sequence has that slot present).
+func mergeStep(outs [][]*Batch, t int) (*Batch, []int) {
+	n := len(outs[0][t].Present)
+	owner := make([]int, n)
+	for j := range owner {
+		owner[j] = -1
+	}
+	for j := 0; j < n; j++ {
+		for i, o := range outs {
+			if o[t].Present[j] {
+				if owner[j] != -1 {
+					panic("anyseq: Merge: overlapping sequence slots")
+				}
+				owner[j] = i
+			}
+		}
+	}
+
+	var creator anyvec.Creator
+	var inc int
+	for _, o := range outs {
+		if o[t].NumPresent() > 0 {
+			creator = o[t].Packed.Creator()
+			inc = o[t].Packed.Len() / o[t].NumPresent()
+			break
+		}
+	}
+	if creator == nil {
+		creator = outs[0][t].Packed.Creator()
+	}
+
+	present := make([]bool, n)
+	dstOffsets := make([][]int, len(outs))
+	var dst int
+	for j := 0; j < n; j++ {
+		if owner[j] == -1 {
+			continue
+		}
+		present[j] = true
+		dstOffsets[owner[j]] = append(dstOffsets[owner[j]], dst)
+		dst += inc
+	}
+
+	packed := creator.MakeVector(dst)
+	for i, o := range outs {
+		if o[t].NumPresent() == 0 {
+			continue
+		}
+		piece := scatterRows(o[t].Packed, inc, dstOffsets[i], dst)
+		packed.Add(piece)
+	}
+
+	return &Batch{Packed: packed, Present: present}, owner
+}
+
+type mergeRes struct {
+	In    []Seq
+	Out   []*Batch
+	Owner [][]int
+}
+
+func (m *mergeRes) Creator() anyvec.Creator {
+	return m.In[0].Creator()
+}
+
+func (m *mergeRes) Output() []*Batch {
+	return m.Out
+}
+
+func (m *mergeRes) Vars() anydiff.VarSet {
+	varSets := make([]anydiff.VarSet, len(m.In))
+	for i, s := range m.In {
+		varSets[i] = s.Vars()
+	}
+	return anydiff.MergeVarSets(varSets...)
+}
+
+// Propagate routes each row of every upstream batch back
+// to the one source Seq that contributed it, mirroring the
+// way Reduce and Expand thread Present masks through the
+// reverse pass.
+func (m *mergeRes) Propagate(u []*Batch, g anydiff.Grad) {
+	srcUp := make([][]*Batch, len(m.In))
+	for i := range srcUp {
+		srcUp[i] = make([]*Batch, len(u))
+	}
+
+	for t, ub := range u {
+		owner := m.Owner[t]
+		n := ub.NumPresent()
+		var inc int
+		if n > 0 {
+			inc = ub.Packed.Len() / n
+		}
+
+		for i := range m.In {
+			present := make([]bool, len(owner))
+			dstOffsets := make([]int, 0, n)
+			var dst int
+			for j, pres := range ub.Present {
+				if !pres {
+					continue
+				}
+				if owner[j] == i {
+					present[j] = true
+					dstOffsets = append(dstOffsets, dst)
+					dst += inc
+				} else {
+					dstOffsets = append(dstOffsets, -1)
+				}
+			}
+			srcUp[i][t] = &Batch{
+				Packed:  scatterRows(ub.Packed, inc, dstOffsets, dst),
+				Present: present,
+			}
+		}
+	}
+
+	for i, s := range m.In {
+		s.Propagate(srcUp[i], g)
+	}
+}
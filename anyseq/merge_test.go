@@ -0,0 +1,135 @@
+package anyseq
+
+import (
+	"testing"
+
+	"github.com/unixpickle/anydiff"
+	"github.com/unixpickle/anyvec"
+	"github.com/unixpickle/anyvec/anyvec32"
+)
+
+// recordingSeq is a minimal Seq used to check that gradient
+// routing (in Merge, ConcatTime, and the streaming
+// adapters) reaches exactly the source it should.
+type recordingSeq struct {
+	out  []*Batch
+	prop []*Batch
+}
+
+func (r *recordingSeq) Creator() anyvec.Creator { return r.out[0].Packed.Creator() }
+func (r *recordingSeq) Output() []*Batch        { return r.out }
+func (r *recordingSeq) Vars() anydiff.VarSet    { return anydiff.VarSet{} }
+func (r *recordingSeq) Propagate(u []*Batch, g anydiff.Grad) {
+	r.prop = u
+}
+
+func TestMergeForwardAndPropagate(t *testing.T) {
+	c := anyvec32.CurrentCreator()
+
+	a := &recordingSeq{out: []*Batch{{
+		Packed:  c.MakeVectorData([]float32{1, 2, 3, 4}),
+		Present: []bool{true, true, false, false},
+	}}}
+	bSeq := &recordingSeq{out: []*Batch{{
+		Packed:  c.MakeVectorData([]float32{5, 6, 7, 8}),
+		Present: []bool{false, false, true, true},
+	}}}
+
+	merged := Merge(a, bSeq)
+	out := merged.Output()
+	if len(out) != 1 {
+		t.Fatalf("expected 1 timestep, got %d", len(out))
+	}
+	wantPresent := []bool{true, true, true, true}
+	for i, p := range wantPresent {
+		if out[0].Present[i] != p {
+			t.Fatalf("present mismatch at %d", i)
+		}
+	}
+	assertFloats(t, out[0].Packed, []float32{1, 2, 3, 4, 5, 6, 7, 8})
+
+	upstream := []*Batch{{
+		Packed:  c.MakeVectorData([]float32{10, 20, 30, 40, 50, 60, 70, 80}),
+		Present: []bool{true, true, true, true},
+	}}
+	merged.Propagate(upstream, anydiff.Grad{})
+
+	if a.prop == nil || bSeq.prop == nil {
+		t.Fatal("expected both sources to receive a gradient")
+	}
+	assertFloats(t, a.prop[0].Packed, []float32{10, 20, 30, 40})
+	assertFloats(t, bSeq.prop[0].Packed, []float32{50, 60, 70, 80})
+	for i, p := range []bool{true, true, false, false} {
+		if a.prop[0].Present[i] != p {
+			t.Fatalf("seqA present mismatch at %d", i)
+		}
+	}
+	for i, p := range []bool{false, false, true, true} {
+		if bSeq.prop[0].Present[i] != p {
+			t.Fatalf("seqB present mismatch at %d", i)
+		}
+	}
+}
+
+// TestMergeMismatchedSlotCounts checks that Merge panics
+// with a descriptive message instead of indexing out of
+// range when its inputs disagree on how many slots a
+// timestep has.
+func TestMergeMismatchedSlotCounts(t *testing.T) {
+	c := anyvec32.CurrentCreator()
+
+	a := &recordingSeq{out: []*Batch{{
+		Packed:  c.MakeVectorData([]float32{1, 2}),
+		Present: []bool{true, true},
+	}}}
+	bSeq := &recordingSeq{out: []*Batch{{
+		Packed:  c.MakeVectorData([]float32{3}),
+		Present: []bool{true},
+	}}}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for mismatched slot counts")
+		}
+	}()
+	Merge(a, bSeq)
+}
+
+func TestConcatTimeSeamPad(t *testing.T) {
+	c := anyvec32.CurrentCreator()
+
+	a := &recordingSeq{out: []*Batch{{
+		Packed:  c.MakeVectorData([]float32{1, 2}),
+		Present: []bool{true, false},
+	}}}
+	bSeq := &recordingSeq{out: []*Batch{{
+		Packed:  c.MakeVectorData([]float32{10, 20, 30, 40}),
+		Present: []bool{true, false, true},
+	}}}
+
+	cat := ConcatTime(SeamPad, a, bSeq)
+	out := cat.Output()
+	if len(out) != 2 {
+		t.Fatalf("expected 2 timesteps, got %d", len(out))
+	}
+	if len(out[0].Present) != 3 || len(out[1].Present) != 3 {
+		t.Fatalf("expected both batches widened to 3 slots")
+	}
+	assertFloats(t, out[0].Packed, []float32{1, 2})
+
+	upstream := []*Batch{
+		{Packed: c.MakeVectorData([]float32{100, 200}), Present: []bool{true, false, false}},
+		{Packed: c.MakeVectorData([]float32{1000, 2000, 3000, 4000}), Present: []bool{true, false, true}},
+	}
+	cat.Propagate(upstream, anydiff.Grad{})
+
+	if len(a.prop) != 1 || len(a.prop[0].Present) != 2 {
+		t.Fatalf("expected seqA's gradient narrowed back to its original width of 2")
+	}
+	assertFloats(t, a.prop[0].Packed, []float32{100, 200})
+
+	if len(bSeq.prop) != 1 || len(bSeq.prop[0].Present) != 3 {
+		t.Fatalf("expected seqB's gradient to keep its original width of 3")
+	}
+	assertFloats(t, bSeq.prop[0].Packed, []float32{1000, 2000, 3000, 4000})
+}
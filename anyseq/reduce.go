@@ -17,29 +17,26 @@ func (b *Batch) Reduce(present []bool) *Batch {
 	n := b.NumPresent()
 	inc := b.Packed.Len() / n
 
-	var chunks []anyvec.Vector
-	var chunkStart, chunkSize int
+	dstOffsets := make([]int, 0, n)
+	var dstOff int
 	for i, pres := range present {
-		if pres {
-			if !b.Present[i] {
-				panic("cannot re-add sequences")
-			}
-			chunkSize += inc
-		} else if b.Present[i] {
-			if chunkSize > 0 {
-				chunks = append(chunks, b.Packed.Slice(chunkStart, chunkStart+chunkSize))
-				chunkStart += chunkSize
-				chunkSize = 0
+		if pres && !b.Present[i] {
+			panic("cannot re-add sequences")
+		}
+		if b.Present[i] {
+			if pres {
+				dstOffsets = append(dstOffsets, dstOff)
+			} else {
+				dstOffsets = append(dstOffsets, -1)
 			}
-			chunkStart += inc
 		}
-	}
-	if chunkSize > 0 {
-		chunks = append(chunks, b.Packed.Slice(chunkStart, chunkStart+chunkSize))
+		if pres {
+			dstOff += inc
+		}
 	}
 
 	return &Batch{
-		Packed:  b.Packed.Creator().Concat(chunks...),
+		Packed:  scatterRows(b.Packed, inc, dstOffsets, dstOff),
 		Present: present,
 	}
 }
@@ -55,41 +52,27 @@ func (b *Batch) Reduce(present []bool) *Batch {
 func (b *Batch) Expand(present []bool) *Batch {
 	n := b.NumPresent()
 	inc := b.Packed.Len() / n
-	filler := b.Packed.Creator().MakeVector(inc)
-
-	var chunks []anyvec.Vector
-	var chunkStart, chunkSize int
 
+	dstOffsets := make([]int, 0, n)
+	var dstOff int
 	for i, pres := range present {
+		if b.Present[i] && !pres {
+			panic("argument to Expand must be a superset")
+		}
 		if b.Present[i] {
-			if !pres {
-				panic("argument to Expand must be a superset")
-			}
-			chunkSize += inc
-		} else if pres {
-			if chunkSize > 0 {
-				chunks = append(chunks, b.Packed.Slice(chunkStart, chunkStart+chunkSize))
-				chunkStart += chunkSize
-				chunkSize = 0
-			}
-			chunks = append(chunks, filler)
+			dstOffsets = append(dstOffsets, dstOff)
+		}
+		if pres {
+			dstOff += inc
 		}
-	}
-	if chunkSize > 0 {
-		chunks = append(chunks, b.Packed.Slice(chunkStart, chunkSize+chunkStart))
 	}
 
 	return &Batch{
-		Packed:  b.Packed.Creator().Concat(chunks...),
+		Packed:  scatterRows(b.Packed, inc, dstOffsets, dstOff),
 		Present: present,
 	}
 }
 
-type reduceRes struct {
-	In  Seq
-	Out []*Batch
-}
-
 // Reduce reduces all of the batches in a Seq to be
 // subsets of the present list.
 //
@@ -100,90 +83,217 @@ type reduceRes struct {
 // sequence indices within the batch.
 // To remove these empty sequences, use Prune().
 func Reduce(s Seq, present []bool) Seq {
-	in := s.Output()
-	res := &reduceRes{In: s, Out: make([]*Batch, len(in))}
-	for i, x := range in {
-		p := make([]bool, len(present))
-		for i, b := range present {
-			p[i] = b && x.Present[i]
-		}
-		res.Out[i] = x.Reduce(p)
-		if res.Out[i].NumPresent() == 0 {
-			res.Out = res.Out[:i]
-			break
-		}
-	}
-	return res
+	return Collect(ReduceStreaming(AsStreaming(s), present))
 }
 
-func (r *reduceRes) Creator() anyvec.Creator {
-	return r.In.Creator()
+// ReduceStreaming is the streaming counterpart to Reduce:
+// it pulls its input one batch at a time instead of
+// requiring the whole sequence up front.
+func ReduceStreaming(s StreamingSeq, present []bool) StreamingSeq {
+	return &reduceRes{in: s, present: present}
 }
 
-func (r *reduceRes) Output() []*Batch {
-	return r.Out
+// reduceRes implements StreamingSeq natively: it tracks,
+// for every batch it has handed out, the present map of
+// the underlying input batch it was reduced from, so
+// Propagate can Expand the matching upstream gradient back
+// to the present map r.in.Propagate expects.
+type reduceRes struct {
+	in      StreamingSeq
+	present []bool
+
+	origPres []([]bool)
+	pos      int
+	tail     []*Batch
+	done     bool
+}
+
+func (r *reduceRes) Creator() anyvec.Creator {
+	return r.in.Creator()
 }
 
 func (r *reduceRes) Vars() anydiff.VarSet {
-	return r.In.Vars()
+	return r.in.Vars()
 }
 
-func (r *reduceRes) Propagate(u []*Batch, grad anydiff.Grad) {
-	inOut := r.In.Output()
-	newU := make([]*Batch, len(inOut))
-	for i, x := range u {
-		newU[i] = x.Expand(inOut[i].Present)
+func (r *reduceRes) Next() (*Batch, bool) {
+	if r.done {
+		return nil, false
+	}
+	in, ok := r.in.Next()
+	if !ok {
+		r.done = true
+		return nil, false
+	}
+
+	p := make([]bool, len(r.present))
+	for i, b := range r.present {
+		p[i] = b && in.Present[i]
 	}
-	for i := len(u); i < len(inOut); i++ {
-		newU[i] = &Batch{
-			Packed:  inOut[i].Packed.Creator().MakeVector(inOut[i].Packed.Len()),
-			Present: inOut[i].Present,
+	out := in.Reduce(p)
+	if out.NumPresent() == 0 {
+		// Once the reduced sequence goes empty, it never
+		// comes back, so the stream (and the Seq that
+		// Reduce returns) ends at this point. Drain the rest of the
+		// input now so that Propagate can still give it a
+		// gradient for every one of its timesteps.
+		r.tail = append(r.tail, in)
+		for {
+			next, ok := r.in.Next()
+			if !ok {
+				break
+			}
+			r.tail = append(r.tail, next)
 		}
+		r.done = true
+		return nil, false
 	}
-	r.In.Propagate(newU, grad)
+
+	r.origPres = append(r.origPres, in.Present)
+	return out, true
 }
 
-type pruneRes struct {
-	In  Seq
-	Out []*Batch
+func (r *reduceRes) Reset() {
+	r.in.Reset()
+	r.origPres = nil
+	r.pos = 0
+	r.tail = nil
+	r.done = false
 }
 
-// Prune removes all empty sequences from the batch.
-func Prune(s Seq) Seq {
-	sOut := s.Output()
-	if len(sOut) == 0 {
-		return s
+// flush propagates a zero gradient for every timestep that
+// Next silently dropped from the underlying input once the
+// reduced sequence went empty. Collect calls it exactly once
+// per Seq-level Propagate call, before forwarding the real
+// upstream batches, so it runs fresh on every round (needed
+// since r.in, e.g. a streamingAdapter, expects exactly one
+// Propagate per batch Next ever produced, every round).
+func (r *reduceRes) flush(g anydiff.Grad) {
+	for i := len(r.tail) - 1; i >= 0; i-- {
+		t := r.tail[i]
+		r.in.Propagate(&Batch{
+			Packed:  t.Packed.Creator().MakeVector(t.Packed.Len()),
+			Present: t.Present,
+		}, g)
 	}
-	out := make([]*Batch, len(sOut))
-	for i, x := range sOut {
-		var newPres []bool
-		for j, keep := range sOut[0].Present {
-			if keep {
-				newPres = append(newPres, x.Present[j])
-			}
-		}
-		out[i] = &Batch{Packed: x.Packed, Present: newPres}
+}
+
+func (r *reduceRes) Propagate(upstream *Batch, g anydiff.Grad) {
+	orig := r.origPres[nextReverseIndex(&r.pos, len(r.origPres))]
+	r.in.Propagate(upstream.Expand(orig), g)
+}
+
+// Expand is the Seq-level counterpart to Reduce: it
+// inserts empty rows into every batch of s to produce the
+// requested present map.
+//
+// It is invalid for present[i] to be false whenever any
+// batch of s has Present[i] true.
+func Expand(s Seq, present []bool) Seq {
+	return Collect(ExpandStreaming(AsStreaming(s), present))
+}
+
+// ExpandStreaming is the streaming counterpart to Expand.
+func ExpandStreaming(s StreamingSeq, present []bool) StreamingSeq {
+	return &expandRes{in: s, present: present}
+}
+
+type expandRes struct {
+	in      StreamingSeq
+	present []bool
+
+	srcPres [][]bool
+	pos     int
+}
+
+func (e *expandRes) Creator() anyvec.Creator {
+	return e.in.Creator()
+}
+
+func (e *expandRes) Vars() anydiff.VarSet {
+	return e.in.Vars()
+}
+
+func (e *expandRes) Next() (*Batch, bool) {
+	in, ok := e.in.Next()
+	if !ok {
+		return nil, false
 	}
-	return &pruneRes{In: s, Out: out}
+	e.srcPres = append(e.srcPres, in.Present)
+	return in.Expand(e.present), true
 }
 
-func (p *pruneRes) Creator() anyvec.Creator {
-	return p.In.Creator()
+func (e *expandRes) Reset() {
+	e.in.Reset()
+	e.srcPres = nil
+	e.pos = 0
 }
 
-func (p *pruneRes) Output() []*Batch {
-	return p.Out
+func (e *expandRes) Propagate(upstream *Batch, g anydiff.Grad) {
+	p := e.srcPres[nextReverseIndex(&e.pos, len(e.srcPres))]
+	e.in.Propagate(upstream.Reduce(p), g)
+}
+
+// Prune removes all empty sequences from the batch.
+func Prune(s Seq) Seq {
+	return Collect(PruneStreaming(AsStreaming(s)))
+}
+
+// PruneStreaming is the streaming counterpart to Prune.
+func PruneStreaming(s StreamingSeq) StreamingSeq {
+	return &pruneRes{in: s}
+}
+
+// pruneRes implements StreamingSeq natively. The present
+// map of the first batch it sees decides which sequence
+// slots are kept for the rest of the stream; for Prune,
+// that is the first batch of Output.
+type pruneRes struct {
+	in   StreamingSeq
+	mask []bool
+	have bool
+
+	origPres [][]bool
+	pos      int
+}
+
+func (p *pruneRes) Creator() anyvec.Creator {
+	return p.in.Creator()
 }
 
 func (p *pruneRes) Vars() anydiff.VarSet {
-	return p.In.Vars()
+	return p.in.Vars()
 }
 
-func (p *pruneRes) Propagate(u []*Batch, g anydiff.Grad) {
-	matchingUp := make([]*Batch, len(u))
-	in := p.In.Output()
-	for i, x := range u {
-		matchingUp[i] = &Batch{Packed: x.Packed, Present: in[i].Present}
+func (p *pruneRes) Next() (*Batch, bool) {
+	in, ok := p.in.Next()
+	if !ok {
+		return nil, false
+	}
+	if !p.have {
+		p.mask = in.Present
+		p.have = true
+	}
+	p.origPres = append(p.origPres, in.Present)
+
+	var newPres []bool
+	for j, keep := range p.mask {
+		if keep {
+			newPres = append(newPres, in.Present[j])
+		}
 	}
-	p.In.Propagate(matchingUp, g)
+	return &Batch{Packed: in.Packed, Present: newPres}, true
+}
+
+func (p *pruneRes) Reset() {
+	p.in.Reset()
+	p.mask = nil
+	p.have = false
+	p.origPres = nil
+	p.pos = 0
+}
+
+func (p *pruneRes) Propagate(upstream *Batch, g anydiff.Grad) {
+	orig := p.origPres[nextReverseIndex(&p.pos, len(p.origPres))]
+	p.in.Propagate(&Batch{Packed: upstream.Packed, Present: orig}, g)
 }
@@ -0,0 +1,87 @@
+package anyseq
+
+import (
+	"testing"
+
+	"github.com/unixpickle/anyvec"
+	"github.com/unixpickle/anyvec/anyvec32"
+)
+
+func TestBatchReduce(t *testing.T) {
+	c := anyvec32.CurrentCreator()
+	b := &Batch{
+		Packed:  c.MakeVectorData([]float32{1, 2, 3, 4, 5, 6}),
+		Present: []bool{true, false, true, true, false},
+	}
+
+	reduced := b.Reduce([]bool{true, false, false, true, false})
+	assertFloats(t, reduced.Packed, []float32{1, 2, 5, 6})
+	if reduced.NumPresent() != 2 {
+		t.Fatalf("expected 2 present rows, got %d", reduced.NumPresent())
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic when re-adding a removed sequence")
+			}
+		}()
+		b.Reduce([]bool{true, true, true, true, false})
+	}()
+}
+
+func TestBatchExpand(t *testing.T) {
+	c := anyvec32.CurrentCreator()
+	b := &Batch{
+		Packed:  c.MakeVectorData([]float32{1, 2, 5, 6}),
+		Present: []bool{true, false, false, true, false},
+	}
+
+	expanded := b.Expand([]bool{true, false, true, true, false})
+	assertFloats(t, expanded.Packed, []float32{1, 2, 0, 0, 5, 6})
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic when dropping a present sequence")
+			}
+		}()
+		b.Expand([]bool{true, false, false, false, false})
+	}()
+}
+
+// TestBatchReduceExpandRoundTrip checks that reducing and
+// then expanding a batch back to its original present map
+// keeps the retained rows at their original offsets and
+// zeroes the rows that were dropped, which is the invariant the
+// fused RowScatterer path (and its Slice/Concat fallback)
+// both need to preserve.
+func TestBatchReduceExpandRoundTrip(t *testing.T) {
+	c := anyvec32.CurrentCreator()
+	original := &Batch{
+		Packed:  c.MakeVectorData([]float32{1, 2, 3, 4, 5, 6, 7, 8}),
+		Present: []bool{true, true, false, true, true},
+	}
+
+	reduced := original.Reduce([]bool{true, false, false, false, true})
+	roundTripped := reduced.Expand(original.Present)
+
+	want := []float32{1, 2, 0, 0, 0, 0, 7, 8}
+	assertFloats(t, roundTripped.Packed, want)
+}
+
+func assertFloats(t *testing.T, v anyvec.Vector, want []float32) {
+	t.Helper()
+	got, ok := v.Data().([]float32)
+	if !ok {
+		t.Fatalf("unexpected vector data type %T", v.Data())
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d values, got %d", len(want), len(got))
+	}
+	for i, x := range want {
+		if float32(got[i]) != x {
+			t.Errorf("index %d: expected %v got %v", i, x, got[i])
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package anyseq
+
+import "github.com/unixpickle/anyvec"
+
+// RowScatterer is an optional interface for anyvec.Creator
+// implementations that support a fused kernel for moving
+// the rows of a packed sequence vector to new offsets.
+//
+// Without it, rearranging rows (as Batch.Reduce,
+// Batch.Expand, and reduceRes.Propagate all need to do)
+// falls back to a Slice per contiguous run of rows plus a
+// single Concat, which on some creators (notably GPU-backed
+// ones) allocates and copies far more than necessary.
+type RowScatterer interface {
+	// ScatterRows copies the rows of src, each rowSize
+	// elements long, into a new outLen-element vector.
+	//
+	// dstOffsets has one entry per row of src, in row
+	// order: dstOffsets[i] is the element offset at which
+	// row i should land in the result, or a negative
+	// number if row i should be dropped. Any part of the
+	// result not written by a row is zero.
+	ScatterRows(src anyvec.Vector, rowSize int, dstOffsets []int, outLen int) anyvec.Vector
+}
+
+// scatterRows rearranges the rows of src as described by
+// dstOffsets, using src.Creator()'s fused kernel when it
+// implements RowScatterer and falling back to Slice/Concat
+// otherwise.
+func scatterRows(src anyvec.Vector, rowSize int, dstOffsets []int, outLen int) anyvec.Vector {
+	if sc, ok := src.Creator().(RowScatterer); ok {
+		return sc.ScatterRows(src, rowSize, dstOffsets, outLen)
+	}
+	return scatterRowsFallback(src, rowSize, dstOffsets, outLen)
+}
+
+// scatterRowsFallback implements scatterRows without a
+// fused kernel. It still merges consecutive rows that map
+// to consecutive destination offsets into a single Slice,
+// so it issues no more Slice/Concat calls than the
+// hand-written Reduce/Expand loops used to.
+//
+// It handles only layouts where the non-negative entries of
+// dstOffsets increase and kept rows do not overlap, as
+// every caller in this package passes; other layouts are
+// not rearranged correctly.
+func scatterRowsFallback(src anyvec.Vector, rowSize int, dstOffsets []int, outLen int) anyvec.Vector {
+	var chunks []anyvec.Vector
+	var pos, runStart, runLen int
+
+	flush := func() {
+		if runLen > 0 {
+			chunks = append(chunks, src.Slice(runStart, runStart+runLen))
+			runLen = 0
+		}
+	}
+
+	for i, dst := range dstOffsets {
+		if dst < 0 {
+			flush()
+			continue
+		}
+		if dst > pos {
+			flush()
+			chunks = append(chunks, src.Creator().MakeVector(dst-pos))
+			pos = dst
+		}
+		if runLen == 0 {
+			runStart = i * rowSize
+		}
+		runLen += rowSize
+		pos += rowSize
+	}
+	flush()
+	if pos < outLen {
+		chunks = append(chunks, src.Creator().MakeVector(outLen-pos))
+	}
+
+	return src.Creator().Concat(chunks...)
+}
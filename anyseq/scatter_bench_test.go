@@ -0,0 +1,73 @@
+package anyseq
+
+import (
+	"testing"
+
+	"github.com/unixpickle/anyvec"
+	"github.com/unixpickle/anyvec/anyvec32"
+)
+
+// fusedCreator wraps an anyvec.Creator and implements
+// RowScatterer directly against the underlying float
+// slice, standing in for the single-kernel implementation
+// a real GPU creator would provide. It lets the benchmark
+// below exercise the RowScatterer path without requiring
+// GPU hardware in CI.
+type fusedCreator struct {
+	anyvec.Creator
+}
+
+func (f fusedCreator) ScatterRows(src anyvec.Vector, rowSize int, dstOffsets []int, outLen int) anyvec.Vector {
+	in := src.Data().([]float32)
+	out := make([]float32, outLen)
+	for i, dst := range dstOffsets {
+		if dst < 0 {
+			continue
+		}
+		copy(out[dst:dst+rowSize], in[i*rowSize:(i+1)*rowSize])
+	}
+	return f.Creator.MakeVectorData(out)
+}
+
+func benchmarkReduceExpand(b *testing.B, c anyvec.Creator) {
+	const (
+		numSlots = 256
+		rowSize  = 32
+	)
+	present := make([]bool, numSlots)
+	for i := range present {
+		present[i] = i%2 == 0
+	}
+	data := make([]float32, (numSlots/2)*rowSize)
+	batch := &Batch{Packed: c.MakeVectorData(data), Present: present}
+
+	reduced := make([]bool, numSlots)
+	copy(reduced, present)
+	reduced[0] = false
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := batch.Reduce(reduced)
+		r.Expand(present)
+	}
+}
+
+// BenchmarkReduceExpandFallback exercises the Slice/Concat
+// fallback path, used by creators without a RowScatterer
+// (such as a typical GPU creator that hasn't opted in).
+func BenchmarkReduceExpandFallback(b *testing.B) {
+	benchmarkReduceExpand(b, anyvec32.CurrentCreator())
+}
+
+// BenchmarkReduceExpandFused exercises the single-kernel
+// RowScatterer path, for comparison against
+// BenchmarkReduceExpandFallback. The win scatterRows is
+// meant to unlock comes from avoiding many small Slice/
+// Concat allocations and copies; that cost is dominated by
+// a real GPU creator's per-call overhead, which fusedCreator
+// (plain slice copies against the CPU creator used in
+// tests) doesn't reproduce, so don't expect this benchmark
+// to reliably show a win on its own.
+func BenchmarkReduceExpandFused(b *testing.B) {
+	benchmarkReduceExpand(b, fusedCreator{anyvec32.CurrentCreator()})
+}
@@ -0,0 +1,148 @@
+package anyseq
+
+import (
+	"github.com/unixpickle/anydiff"
+	"github.com/unixpickle/anyvec"
+)
+
+// StreamingSeq is a Seq whose batches are produced one at
+// a time instead of all at once, so that a long rollout's
+// per-timestep *Batch values don't all need to coexist in
+// memory (e.g. on the GPU) before backprop can start.
+type StreamingSeq interface {
+	Creator() anyvec.Creator
+	Vars() anydiff.VarSet
+
+	// Next returns the next batch in the sequence, or
+	// ok == false once the sequence is exhausted.
+	Next() (batch *Batch, ok bool)
+
+	// Reset rewinds the sequence so that Next produces its
+	// first batch again.
+	Reset()
+
+	// Propagate takes the upstream gradient for the most
+	// recently produced batch and routes it backward.
+	//
+	// Callers must call Next until it returns false, then
+	// call Propagate exactly once per batch that Next
+	// returned, in reverse order.
+	Propagate(upstream *Batch, g anydiff.Grad)
+}
+
+// AsStreaming adapts a Seq to a StreamingSeq by
+// materializing its Output once and replaying it batch by
+// batch.
+func AsStreaming(s Seq) StreamingSeq {
+	return &streamingAdapter{Seq: s}
+}
+
+type streamingAdapter struct {
+	Seq
+	pos int
+	ups []*Batch
+}
+
+func (s *streamingAdapter) Next() (*Batch, bool) {
+	out := s.Seq.Output()
+	if s.pos >= len(out) {
+		return nil, false
+	}
+	b := out[s.pos]
+	s.pos++
+	return b, true
+}
+
+func (s *streamingAdapter) Reset() {
+	s.pos = 0
+	s.ups = nil
+}
+
+func (s *streamingAdapter) Propagate(upstream *Batch, g anydiff.Grad) {
+	s.ups = append(s.ups, upstream)
+	if len(s.ups) == len(s.Seq.Output()) {
+		full := make([]*Batch, len(s.ups))
+		for i, u := range s.ups {
+			full[len(s.ups)-1-i] = u
+		}
+		s.Seq.Propagate(full, g)
+		s.ups = nil
+	}
+}
+
+// Collect consumes every batch of a StreamingSeq and
+// returns an ordinary Seq backed by the result.
+//
+// This negates the memory benefits of streaming, so it is
+// meant as a compatibility shim for code that still wants
+// a Seq.
+func Collect(s StreamingSeq) Seq {
+	s.Reset()
+	var out []*Batch
+	for {
+		b, ok := s.Next()
+		if !ok {
+			break
+		}
+		out = append(out, b)
+	}
+	return &collectRes{In: s, Out: out}
+}
+
+type collectRes struct {
+	In  StreamingSeq
+	Out []*Batch
+}
+
+func (c *collectRes) Creator() anyvec.Creator {
+	return c.In.Creator()
+}
+
+func (c *collectRes) Output() []*Batch {
+	return c.Out
+}
+
+func (c *collectRes) Vars() anydiff.VarSet {
+	return c.In.Vars()
+}
+
+// nextReverseIndex returns the next index to consume when
+// replaying n pieces of per-batch state in reverse order,
+// resetting back to n once all of them have been consumed.
+//
+// StreamingSeq implementations that record one piece of
+// state per batch (e.g. reduceRes, expandRes, pruneRes) use
+// this instead of destructively popping a slice, so that
+// their Propagate can be driven through more than one full
+// reverse pass, matching the Seq contract that Propagate
+// may be called multiple times to accumulate gradients.
+func nextReverseIndex(pos *int, n int) int {
+	if *pos == 0 {
+		*pos = n
+	}
+	*pos--
+	return *pos
+}
+
+// flusher is an optional interface for StreamingSeq
+// implementations that buffer part of their backward pass
+// instead of running it inline with Propagate (e.g.
+// reduceRes, which defers zeroing out timesteps it dropped
+// from the stream). Collect calls it unconditionally, once
+// per Seq-level Propagate call and before forwarding the
+// real upstream batches, so that buffered state still gets
+// flushed even when Next never produced a single batch, and
+// flushes again on every later round if Propagate is called
+// more than once to accumulate gradients.
+type flusher interface {
+	flush(g anydiff.Grad)
+}
+
+func (c *collectRes) Propagate(u []*Batch, g anydiff.Grad) {
+	if f, ok := c.In.(flusher); ok {
+		f.flush(g)
+	}
+	for i := len(u) - 1; i >= 0; i-- {
+		c.In.Propagate(u[i], g)
+	}
+}
@@ -0,0 +1,216 @@
+package anyseq
+
+import (
+	"testing"
+
+	"github.com/unixpickle/anydiff"
+	"github.com/unixpickle/anyvec"
+	"github.com/unixpickle/anyvec/anyvec32"
+)
+
+// accumRecordingSeq is like recordingSeq, but records every
+// Propagate call it receives instead of only the last one,
+// so tests can check that a Seq's gradient plumbing fires
+// once per accumulation round rather than just once ever.
+type accumRecordingSeq struct {
+	out   []*Batch
+	calls [][]*Batch
+}
+
+func (r *accumRecordingSeq) Creator() anyvec.Creator { return r.out[0].Packed.Creator() }
+func (r *accumRecordingSeq) Output() []*Batch        { return r.out }
+func (r *accumRecordingSeq) Vars() anydiff.VarSet    { return anydiff.VarSet{} }
+func (r *accumRecordingSeq) Propagate(u []*Batch, g anydiff.Grad) {
+	r.calls = append(r.calls, u)
+}
+
+func makeStreamTestSeq(c anyvec.Creator) *accumRecordingSeq {
+	return &accumRecordingSeq{out: []*Batch{
+		{Packed: c.MakeVectorData([]float32{1, 2}), Present: []bool{true, true}},
+		{Packed: c.MakeVectorData([]float32{3}), Present: []bool{true, false}},
+		{Packed: c.MakeVector(0), Present: []bool{false, false}},
+	}}
+}
+
+// makeReduceTailDrainSeq builds a source whose second and
+// third timesteps keep only slot 0 present, so a mask that
+// keeps slot 1 reduces them to empty while the source
+// batches themselves still have at least one present slot,
+// matching how a real Seq behaves once some of its
+// sequences finish.
+func makeReduceTailDrainSeq(c anyvec.Creator) *accumRecordingSeq {
+	return &accumRecordingSeq{out: []*Batch{
+		{Packed: c.MakeVectorData([]float32{1, 2}), Present: []bool{true, true}},
+		{Packed: c.MakeVectorData([]float32{3}), Present: []bool{true, false}},
+		{Packed: c.MakeVectorData([]float32{5}), Present: []bool{true, false}},
+	}}
+}
+
+// TestReduceStreamingTailDrain drives a multi-timestep Seq
+// through Reduce with a mask that reduces the last 2
+// timesteps to empty, which exercises reduceRes's tail-drain
+// path, and checks that the source still receives a (zero)
+// gradient for those dropped timesteps.
+func TestReduceStreamingTailDrain(t *testing.T) {
+	c := anyvec32.CurrentCreator()
+	src := makeReduceTailDrainSeq(c)
+
+	reduced := Reduce(src, []bool{false, true})
+	out := reduced.Output()
+	if len(out) != 1 {
+		t.Fatalf("expected the last 2 timesteps to be dropped, got %d timesteps", len(out))
+	}
+	assertFloats(t, out[0].Packed, []float32{2})
+
+	upstream := []*Batch{
+		{Packed: c.MakeVectorData([]float32{10}), Present: []bool{false, true}},
+	}
+	reduced.Propagate(upstream, anydiff.Grad{})
+
+	if len(src.calls) != 1 {
+		t.Fatalf("expected exactly one Propagate round, got %d", len(src.calls))
+	}
+	got := src.calls[0]
+	if len(got) != 3 {
+		t.Fatalf("expected a gradient for all 3 source timesteps, got %d", len(got))
+	}
+	assertFloats(t, got[0].Packed, []float32{0, 10})
+	assertFloats(t, got[1].Packed, []float32{0})
+	assertFloats(t, got[2].Packed, []float32{0})
+}
+
+// TestReduceStreamingAccumulated checks that calling
+// Propagate twice on the same Reduce result (without an
+// intervening Reset, as Seq's gradient-accumulation
+// contract allows) drives the source through two full
+// rounds rather than losing the second one, which is what
+// used to happen when the tail-drain only ran once ever.
+func TestReduceStreamingAccumulated(t *testing.T) {
+	c := anyvec32.CurrentCreator()
+	src := makeReduceTailDrainSeq(c)
+
+	reduced := Reduce(src, []bool{false, true})
+	upstream := []*Batch{
+		{Packed: c.MakeVectorData([]float32{10}), Present: []bool{false, true}},
+	}
+	reduced.Propagate(upstream, anydiff.Grad{})
+	reduced.Propagate(upstream, anydiff.Grad{})
+
+	if len(src.calls) != 2 {
+		t.Fatalf("expected two Propagate rounds on the source, got %d", len(src.calls))
+	}
+	for i, call := range src.calls {
+		if len(call) != 3 {
+			t.Fatalf("round %d: expected a gradient for all 3 source timesteps, got %d", i, len(call))
+		}
+		assertFloats(t, call[0].Packed, []float32{0, 10})
+		assertFloats(t, call[1].Packed, []float32{0})
+		assertFloats(t, call[2].Packed, []float32{0})
+	}
+}
+
+// TestPruneStreamingMultiTimestep checks Prune across more
+// than one timestep, where a slot that the first batch
+// marks as structurally unused (and so gets pruned) stays
+// unused for the rest of the stream.
+func TestPruneStreamingMultiTimestep(t *testing.T) {
+	c := anyvec32.CurrentCreator()
+	src := &accumRecordingSeq{out: []*Batch{
+		{Packed: c.MakeVectorData([]float32{1}), Present: []bool{true, false}},
+		{Packed: c.MakeVectorData([]float32{3}), Present: []bool{true, false}},
+	}}
+
+	pruned := Prune(src)
+	out := pruned.Output()
+	if len(out) != 2 {
+		t.Fatalf("expected 2 timesteps, got %d", len(out))
+	}
+	assertFloats(t, out[0].Packed, []float32{1})
+	assertFloats(t, out[1].Packed, []float32{3})
+
+	upstream := []*Batch{
+		{Packed: c.MakeVectorData([]float32{10}), Present: []bool{true}},
+		{Packed: c.MakeVectorData([]float32{20}), Present: []bool{true}},
+	}
+	pruned.Propagate(upstream, anydiff.Grad{})
+
+	if len(src.calls) != 1 {
+		t.Fatalf("expected exactly one Propagate round, got %d", len(src.calls))
+	}
+	got := src.calls[0]
+	assertFloats(t, got[0].Packed, []float32{10})
+	assertFloats(t, got[1].Packed, []float32{20})
+}
+
+// TestExpandStreamingMultiTimestep checks Expand across more
+// than one timestep, reducing the gradient of each back to
+// its own original present map.
+func TestExpandStreamingMultiTimestep(t *testing.T) {
+	c := anyvec32.CurrentCreator()
+	src := &accumRecordingSeq{out: []*Batch{
+		{Packed: c.MakeVectorData([]float32{1}), Present: []bool{true, false}},
+		{Packed: c.MakeVectorData([]float32{2, 3}), Present: []bool{true, true}},
+	}}
+
+	expanded := Expand(src, []bool{true, true})
+	out := expanded.Output()
+	if len(out) != 2 {
+		t.Fatalf("expected 2 timesteps, got %d", len(out))
+	}
+	assertFloats(t, out[0].Packed, []float32{1, 0})
+	assertFloats(t, out[1].Packed, []float32{2, 3})
+
+	upstream := []*Batch{
+		{Packed: c.MakeVectorData([]float32{10, 20}), Present: []bool{true, true}},
+		{Packed: c.MakeVectorData([]float32{30, 40}), Present: []bool{true, true}},
+	}
+	expanded.Propagate(upstream, anydiff.Grad{})
+
+	if len(src.calls) != 1 {
+		t.Fatalf("expected exactly one Propagate round, got %d", len(src.calls))
+	}
+	got := src.calls[0]
+	assertFloats(t, got[0].Packed, []float32{10})
+	assertFloats(t, got[1].Packed, []float32{30, 40})
+}
+
+// TestAsStreamingCollectRoundTrip checks that AsStreaming
+// followed by Collect reproduces the original Seq's forward
+// output and routes gradients back unchanged.
+func TestAsStreamingCollectRoundTrip(t *testing.T) {
+	c := anyvec32.CurrentCreator()
+	src := makeStreamTestSeq(c)
+
+	collected := Collect(AsStreaming(src))
+	out := collected.Output()
+	if len(out) != len(src.out) {
+		t.Fatalf("expected %d timesteps, got %d", len(src.out), len(out))
+	}
+	for i, b := range src.out {
+		assertFloats(t, out[i].Packed, mustFloat32(t, b.Packed))
+	}
+
+	upstream := []*Batch{
+		{Packed: c.MakeVectorData([]float32{10, 20}), Present: []bool{true, true}},
+		{Packed: c.MakeVectorData([]float32{30}), Present: []bool{true, false}},
+		{Packed: c.MakeVector(0), Present: []bool{false, false}},
+	}
+	collected.Propagate(upstream, anydiff.Grad{})
+
+	if len(src.calls) != 1 {
+		t.Fatalf("expected exactly one Propagate round, got %d", len(src.calls))
+	}
+	got := src.calls[0]
+	assertFloats(t, got[0].Packed, []float32{10, 20})
+	assertFloats(t, got[1].Packed, []float32{30})
+	assertFloats(t, got[2].Packed, []float32{})
+}
+
+func mustFloat32(t *testing.T, v anyvec.Vector) []float32 {
+	t.Helper()
+	data, ok := v.Data().([]float32)
+	if !ok {
+		t.Fatalf("unexpected vector data type %T", v.Data())
+	}
+	return data
+}